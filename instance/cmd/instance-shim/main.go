@@ -0,0 +1,208 @@
+// Command instance-shim is execed by instancecontrol, once per managed
+// process, into its own session. It forks the real command, writes a
+// handshake file with its pid so the controller can learn it without racing
+// the fork, streams stdout/stderr to the given log files (optionally through
+// a logrotate.Writer, serving tail/follow requests on a log socket), and
+// stays alive to wait(2) the child and publish its exit status on a unix
+// socket. The shim itself exits with a code mirroring the child's (0, its
+// exit code, or 128+signal), so a controller that is still its direct parent
+// can also learn the outcome the ordinary way, via cmd.Wait.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+
+	"instance/instanceshim"
+	"instance/logrotate"
+)
+
+func main() {
+	dir := flag.String("dir", "", "working directory for the managed process")
+	stdoutPath := flag.String("stdout", "", "path to append the managed process's stdout to")
+	stderrPath := flag.String("stderr", "", "path to append the managed process's stderr to")
+	handshakePath := flag.String("handshake", "", "path to write the {pid} handshake to once the child starts")
+	socketPath := flag.String("socket", "", "unix socket to publish exit status on")
+	logMaxSize := flag.Int64("log-max-size", 0, "rotate stdout/stderr once a segment reaches this many bytes (0 disables rotation)")
+	logMaxFiles := flag.Int("log-max-files", 5, "number of rolled segments to keep per stream")
+	logCompress := flag.Bool("log-compress", false, "gzip rolled segments")
+	logStdoutIndex := flag.Int("log-stdout-index", 0, "rotation index to resume stdout.log numbering from")
+	logStderrIndex := flag.Int("log-stderr-index", 0, "rotation index to resume stderr.log numbering from")
+	logSocketPath := flag.String("logsocket", "", "unix socket to serve log tail/follow requests on; requires log-max-size > 0")
+	flag.Parse()
+
+	cmdArgs := flag.Args()
+	if len(cmdArgs) == 0 {
+		log.Fatal("instance-shim: no command given after --")
+	}
+
+	cmd := exec.Command(cmdArgs[0], cmdArgs[1:]...)
+	cmd.Dir = *dir
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	var stdoutWriter, stderrWriter *logrotate.Writer
+	if *stdoutPath != "" {
+		if *logMaxSize > 0 {
+			if w, err := logrotate.New(*stdoutPath, *logMaxSize, *logMaxFiles, *logCompress, *logStdoutIndex); err == nil {
+				stdoutWriter = w
+				defer w.Close()
+				cmd.Stdout = w
+			}
+		} else if f, err := os.OpenFile(*stdoutPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644); err == nil {
+			defer f.Close()
+			cmd.Stdout = f
+		}
+	}
+	if *stderrPath != "" {
+		if *logMaxSize > 0 {
+			if w, err := logrotate.New(*stderrPath, *logMaxSize, *logMaxFiles, *logCompress, *logStderrIndex); err == nil {
+				stderrWriter = w
+				defer w.Close()
+				cmd.Stderr = w
+			}
+		} else if f, err := os.OpenFile(*stderrPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644); err == nil {
+			defer f.Close()
+			cmd.Stderr = f
+		}
+	}
+
+	if *logSocketPath != "" {
+		_ = os.Remove(*logSocketPath)
+		if l, err := net.Listen("unix", *logSocketPath); err == nil {
+			defer func() {
+				l.Close()
+				_ = os.Remove(*logSocketPath)
+			}()
+			go serveLogs(l, stdoutWriter, stderrWriter)
+		}
+	}
+
+	if err := cmd.Start(); err != nil {
+		log.Fatalf("instance-shim: start child: %v", err)
+	}
+
+	if *handshakePath != "" {
+		writeHandshake(*handshakePath, instanceshim.Handshake{PID: cmd.Process.Pid})
+	}
+
+	var mu sync.Mutex
+	status := instanceshim.Status{PID: cmd.Process.Pid}
+	done := make(chan struct{})
+
+	var listener net.Listener
+	if *socketPath != "" {
+		_ = os.Remove(*socketPath)
+		if l, err := net.Listen("unix", *socketPath); err == nil {
+			listener = l
+			go serve(listener, done, &mu, &status)
+		}
+	}
+
+	waitErr := cmd.Wait()
+	mu.Lock()
+	status.Exited = true
+	if waitErr != nil {
+		status.Err = waitErr.Error()
+		status.ExitCode = exitCodeFrom(waitErr)
+	}
+	mu.Unlock()
+	close(done)
+
+	if listener != nil {
+		// Give in-flight and late-arriving reconnects a beat to read the
+		// final status before the socket goes away.
+		time.Sleep(200 * time.Millisecond)
+		listener.Close()
+		_ = os.Remove(*socketPath)
+	}
+
+	os.Exit(status.ExitCode)
+}
+
+func serve(l net.Listener, done <-chan struct{}, mu *sync.Mutex, status *instanceshim.Status) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go func(c net.Conn) {
+			defer c.Close()
+			<-done
+			mu.Lock()
+			s := *status
+			mu.Unlock()
+			_ = json.NewEncoder(c).Encode(s)
+		}(conn)
+	}
+}
+
+// serveLogs answers LogRequests against whichever of stdout/stderr's
+// rotating writer the request names; either may be nil if rotation wasn't
+// enabled for that stream (or at all), in which case the request is
+// dropped.
+func serveLogs(l net.Listener, stdout, stderr *logrotate.Writer) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go handleLogConn(conn, stdout, stderr)
+	}
+}
+
+func handleLogConn(conn net.Conn, stdout, stderr *logrotate.Writer) {
+	defer conn.Close()
+	var req instanceshim.LogRequest
+	if err := json.NewDecoder(conn).Decode(&req); err != nil {
+		return
+	}
+	w := stdout
+	if req.Stream == "stderr" {
+		w = stderr
+	}
+	if w == nil {
+		return
+	}
+	if req.Op == "follow" {
+		ch, cancel := w.Follow()
+		defer cancel()
+		for line := range ch {
+			if _, err := conn.Write([]byte(line + "\n")); err != nil {
+				return
+			}
+		}
+		return
+	}
+	_ = json.NewEncoder(conn).Encode(instanceshim.LogResponse{Lines: w.Tail(req.N)})
+}
+
+func writeHandshake(path string, h instanceshim.Handshake) {
+	b, err := json.Marshal(h)
+	if err != nil {
+		return
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return
+	}
+	_ = os.Rename(tmp, path)
+}
+
+func exitCodeFrom(err error) int {
+	if ee, ok := err.(*exec.ExitError); ok {
+		if ws, ok := ee.Sys().(syscall.WaitStatus); ok {
+			if ws.Signaled() {
+				return 128 + int(ws.Signal())
+			}
+			return ws.ExitStatus()
+		}
+	}
+	return 1
+}
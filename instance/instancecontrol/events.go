@@ -0,0 +1,103 @@
+package instancecontrol
+
+import (
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// subscriberBufferSize bounds how far a subscriber can fall behind before
+// publish starts dropping events for it instead of blocking the caller that
+// triggered the state change.
+const subscriberBufferSize = 16
+
+// InstanceEvent describes a single state transition observed by saveRecord
+// (including the StateRunning->StateStopped sweep inside GetState).
+type InstanceEvent struct {
+	Path     string
+	OldState State
+	NewState State
+	Record   InstanceRecord
+	Time     time.Time
+}
+
+type subscription struct {
+	path    string
+	ch      chan InstanceEvent
+	dropped uint64
+}
+
+// Subscribe returns a channel of InstanceEvent for path alone, and a cancel
+// func that unregisters it and closes the channel. A slow or absent reader
+// only ever loses events off this one channel (publish never blocks on it);
+// it never stalls the reaper or any other subscriber.
+func (c *Controller) Subscribe(path string) (<-chan InstanceEvent, func()) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		absPath = path
+	}
+	sub := &subscription{path: absPath, ch: make(chan InstanceEvent, subscriberBufferSize)}
+
+	c.subsMu.Lock()
+	if c.pathSubs == nil {
+		c.pathSubs = make(map[string][]*subscription)
+	}
+	c.pathSubs[absPath] = append(c.pathSubs[absPath], sub)
+	c.subsMu.Unlock()
+
+	return sub.ch, func() {
+		c.subsMu.Lock()
+		defer c.subsMu.Unlock()
+		subs := c.pathSubs[absPath]
+		for i, s := range subs {
+			if s == sub {
+				c.pathSubs[absPath] = append(subs[:i], subs[i+1:]...)
+				break
+			}
+		}
+		close(sub.ch)
+	}
+}
+
+// SubscribeAll returns a channel of InstanceEvent for every instance the
+// controller manages, plus a cancel func, with the same non-blocking
+// delivery semantics as Subscribe.
+func (c *Controller) SubscribeAll() (<-chan InstanceEvent, func()) {
+	sub := &subscription{ch: make(chan InstanceEvent, subscriberBufferSize)}
+
+	c.subsMu.Lock()
+	c.allSubs = append(c.allSubs, sub)
+	c.subsMu.Unlock()
+
+	return sub.ch, func() {
+		c.subsMu.Lock()
+		defer c.subsMu.Unlock()
+		for i, s := range c.allSubs {
+			if s == sub {
+				c.allSubs = append(c.allSubs[:i], c.allSubs[i+1:]...)
+				break
+			}
+		}
+		close(sub.ch)
+	}
+}
+
+// publish fans ev out to every subscriber of its path plus every
+// SubscribeAll subscriber. Delivery is non-blocking: a subscriber whose
+// buffer is full has the event dropped and its counter bumped rather than
+// stalling the caller (saveRecord, called from the reaper and from Start).
+func (c *Controller) publish(ev InstanceEvent) {
+	c.subsMu.Lock()
+	subs := make([]*subscription, 0, len(c.pathSubs[ev.Path])+len(c.allSubs))
+	subs = append(subs, c.pathSubs[ev.Path]...)
+	subs = append(subs, c.allSubs...)
+	c.subsMu.Unlock()
+
+	for _, s := range subs {
+		select {
+		case s.ch <- ev:
+		default:
+			atomic.AddUint64(&s.dropped, 1)
+		}
+	}
+}
@@ -3,57 +3,166 @@ package instancecontrol
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
 
+	"instance/instanceshim"
+	"instance/logrotate"
 	"instance/mine_db"
 )
 
 type State string
 
 const (
-	StateUnknown  State = "unknown"
-	StateStarting State = "starting"
-	StateRunning  State = "running"
-	StateStopping State = "stopping"
-	StateStopped  State = "stopped"
-	StateFailed   State = "failed"
+	StateUnknown   State = "unknown"
+	StateStarting  State = "starting"
+	StateRunning   State = "running"
+	StateStopping  State = "stopping"
+	StateStopped   State = "stopped"
+	StateFailed    State = "failed"
+	StateRetryWait State = "retry_wait"
 )
 
+// InstancePolicy controls whether and how a dead instance is automatically
+// relaunched by onExit (via finishExit). The zero value disables autorestart
+// entirely.
+type InstancePolicy struct {
+	AutoRestart bool `json:"auto_restart,omitempty"`
+	// StartRetries caps the number of consecutive failures that happened
+	// before StartSeconds elapsed (ranLongEnough == false): once that many
+	// are hit in a row, the instance is given up on and marked StateFailed,
+	// so at most StartRetries-1 relaunches follow a run of too-fast
+	// failures. The zero value and 1 both mean no retries: a single
+	// too-fast failure gives up right away. There is no "unlimited" setting.
+	StartRetries   int           `json:"start_retries,omitempty"`
+	StartSeconds   int           `json:"start_seconds,omitempty"`
+	BackoffInitial time.Duration `json:"backoff_initial,omitempty"`
+	BackoffMax     time.Duration `json:"backoff_max,omitempty"`
+}
+
 type InstanceRecord struct {
-	State     State     `json:"state"`
-	PID       int       `json:"pid,omitempty"`
-	StartedAt time.Time `json:"started_at,omitempty"`
-	StoppedAt time.Time `json:"stopped_at,omitempty"`
-	UpdatedAt time.Time `json:"updated_at"`
-	LastError string    `json:"last_error,omitempty"`
+	State       State          `json:"state"`
+	PID         int            `json:"pid,omitempty"`
+	ShimPID     int            `json:"shim_pid,omitempty"`
+	ShimSocket  string         `json:"shim_socket,omitempty"`
+	StartedAt   time.Time      `json:"started_at,omitempty"`
+	StoppedAt   time.Time      `json:"stopped_at,omitempty"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	LastError   string         `json:"last_error,omitempty"`
+	LaunchCmd   []string       `json:"launch_cmd,omitempty"`
+	Policy      InstancePolicy `json:"policy,omitempty"`
+	RetryCount  int            `json:"retry_count,omitempty"`
+	NextRetryAt time.Time      `json:"next_retry_at,omitempty"`
+
+	// LogSocket is the shim's log socket, set only when log rotation is
+	// enabled (WithLogRotation); Tail and Follow dial it. StdoutRotation and
+	// StderrRotation are the rotation indices logrotate.Writer last reported,
+	// so a controller restart resumes segment numbering instead of
+	// clobbering the newest rolled file.
+	LogSocket      string `json:"log_socket,omitempty"`
+	StdoutRotation int    `json:"stdout_rotation,omitempty"`
+	StderrRotation int    `json:"stderr_rotation,omitempty"`
 }
 
+// DB is a typed key-value store: values are opaque bytes that the caller
+// (here, the controller) is responsible for encoding and decoding. Backends
+// no longer have to round-trip through interface{} and guess at the shape
+// mine_db handed back.
 type DB interface {
-	Set(key string, value interface{}) error
-	Get(key string) (interface{}, error)
+	Get(key string) ([]byte, error)
+	Set(key string, value []byte) error
+	Delete(key string) error
+	// Scan calls fn for every key with the given prefix, in backend-defined
+	// order, stopping early if fn returns false.
+	Scan(prefix string, fn func(key, value []byte) bool) error
 }
 
+// errMineDBUnsupported is returned by the mine_db-backed adapter for
+// operations mine_db has no way to implement (it only ever exposed
+// Get/Set). Switch to leveldbstore for Delete/Scan support.
+var errMineDBUnsupported = errors.New("mineDBAdapter: not supported by mine_db")
+
+// mineDBAdapter bridges the legacy mine_db package (which stores and
+// returns interface{}) onto the typed DB interface. The JSON round-trip that
+// used to live in loadRecord now lives here, so it's contained to the one
+// backend that actually needs it.
 type mineDBAdapter struct{}
 
-func (m mineDBAdapter) Set(key string, value interface{}) error {
+func (m mineDBAdapter) Get(key string) ([]byte, error) {
+	v, err := mine_db.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	if b, ok := v.([]byte); ok {
+		return b, nil
+	}
+	return json.Marshal(v)
+}
+
+func (m mineDBAdapter) Set(key string, value []byte) error {
 	return mine_db.Set(key, value)
 }
 
-func (m mineDBAdapter) Get(key string) (interface{}, error) {
-	return mine_db.Get(key)
+func (m mineDBAdapter) Delete(key string) error {
+	return errMineDBUnsupported
+}
+
+func (m mineDBAdapter) Scan(prefix string, fn func(key, value []byte) bool) error {
+	return errMineDBUnsupported
 }
 
 type Controller struct {
-	gracePeriod time.Duration
-	defaultCmd  []string
-	useAbsPaths bool
-	db          DB
-	watchLock   sync.Mutex
+	gracePeriod   time.Duration
+	defaultCmd    []string
+	useAbsPaths   bool
+	db            DB
+	shimPath      string
+	handshakeWait time.Duration
+
+	logMaxSize  int64
+	logMaxFiles int
+	logCompress bool
+
+	subsMu   sync.Mutex
+	pathSubs map[string][]*subscription
+	allSubs  []*subscription
+
+	// stopMu and stopping back Stop/consumeStopping: Stop marks absPath here
+	// before signaling so that whichever goroutine observes the resulting
+	// exit next — onExit for a locally-launched instance, reconcileOne for
+	// one picked up by Reconcile after a controller restart — treats it as
+	// the deliberate stop it is instead of a crash to autorestart. Keyed by
+	// absPath (not a local instanceHandle) so it works for both.
+	stopMu   sync.Mutex
+	stopping map[string]struct{}
+}
+
+func (c *Controller) markStopping(absPath string) {
+	c.stopMu.Lock()
+	if c.stopping == nil {
+		c.stopping = make(map[string]struct{})
+	}
+	c.stopping[absPath] = struct{}{}
+	c.stopMu.Unlock()
+}
+
+// consumeStopping reports whether absPath was marked by Stop since the last
+// call, clearing the mark either way so it can't leak into a later launch.
+func (c *Controller) consumeStopping(absPath string) bool {
+	c.stopMu.Lock()
+	_, ok := c.stopping[absPath]
+	delete(c.stopping, absPath)
+	c.stopMu.Unlock()
+	return ok
 }
 
 type Option func(*Controller)
@@ -82,11 +191,36 @@ func WithDB(db DB) Option {
 	}
 }
 
+// WithShimPath overrides the instance-shim binary that Start execs into for
+// each managed process. By default the controller looks it up on PATH.
+func WithShimPath(path string) Option {
+	return func(c *Controller) {
+		c.shimPath = path
+	}
+}
+
+// WithLogRotation caps each managed process's stdout.log/stderr.log at
+// maxSize bytes, rolling the current segment to "stdout.log.N" (or
+// "stderr.log.N") on threshold and keeping at most maxFiles of them,
+// optionally gzipping rolled segments. Without this option Start opens the
+// log files with O_APPEND and no size cap, same as before. Enabling it also
+// makes Follow available and lets Tail read from the rotating writer's
+// in-memory ring buffer instead of the plain file. A maxFiles of 0 or less
+// keeps every rolled segment.
+func WithLogRotation(maxSize int64, maxFiles int, compress bool) Option {
+	return func(c *Controller) {
+		c.logMaxSize = maxSize
+		c.logMaxFiles = maxFiles
+		c.logCompress = compress
+	}
+}
+
 func NewController(opts ...Option) *Controller {
 	c := &Controller{
-		gracePeriod: 10 * time.Second,
-		useAbsPaths: true,
-		db:          mineDBAdapter{},
+		gracePeriod:   10 * time.Second,
+		useAbsPaths:   true,
+		db:            mineDBAdapter{},
+		handshakeWait: 2 * time.Second,
 	}
 	for _, o := range opts {
 		o(c)
@@ -94,6 +228,26 @@ func NewController(opts ...Option) *Controller {
 	return c
 }
 
+func (c *Controller) resolveShimPath() (string, error) {
+	if c.shimPath != "" {
+		return c.shimPath, nil
+	}
+	return exec.LookPath("instance-shim")
+}
+
+func shimPaths(absPath string) (handshakePath, socketPath, logSocketPath string) {
+	dir := filepath.Join(absPath, "logs")
+	return filepath.Join(dir, "shim.json"), filepath.Join(dir, "shim.sock"), filepath.Join(dir, "shim-logs.sock")
+}
+
+func logFilePath(absPath, stream string) string {
+	name := "stdout.log"
+	if stream == "stderr" {
+		name = "stderr.log"
+	}
+	return filepath.Join(absPath, "logs", name)
+}
+
 func (c *Controller) formatDBKey(path string) (string, error) {
 	if c.useAbsPaths {
 		abs, err := filepath.Abs(path)
@@ -110,8 +264,19 @@ func (c *Controller) saveRecord(path string, r InstanceRecord) error {
 	if err != nil {
 		return err
 	}
+	old, _ := c.loadRecord(path)
 	r.UpdatedAt = time.Now().UTC()
-	return c.db.Set(key, r)
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if err := c.db.Set(key, b); err != nil {
+		return err
+	}
+	if old.State != r.State {
+		c.publish(InstanceEvent{Path: path, OldState: old.State, NewState: r.State, Record: r, Time: r.UpdatedAt})
+	}
+	return nil
 }
 
 func (c *Controller) loadRecord(path string) (InstanceRecord, error) {
@@ -120,16 +285,12 @@ func (c *Controller) loadRecord(path string) (InstanceRecord, error) {
 	if err != nil {
 		return r, err
 	}
-	v, err := c.db.Get(key)
+	b, err := c.db.Get(key)
 	if err != nil {
 		r.State = StateUnknown
 		r.UpdatedAt = time.Now().UTC()
 		return r, nil
 	}
-	b, err := json.Marshal(v)
-	if err != nil {
-		return r, err
-	}
 	if err := json.Unmarshal(b, &r); err != nil {
 		return r, err
 	}
@@ -151,6 +312,14 @@ func isPidAlive(pid int) bool {
 }
 
 func (c *Controller) Start(targetPath string, launchCmd []string) error {
+	return c.StartWithPolicy(targetPath, launchCmd, InstancePolicy{})
+}
+
+// StartWithPolicy launches the instance the same way Start does, but attaches
+// an InstancePolicy that governs automatic relaunching on unexpected exit.
+// The policy is persisted on the InstanceRecord so it survives controller
+// restarts and is reused by the reaper's retry loop in onExit.
+func (c *Controller) StartWithPolicy(targetPath string, launchCmd []string, policy InstancePolicy) error {
 	absPath, err := filepath.Abs(targetPath)
 	if err != nil {
 		return err
@@ -168,66 +337,327 @@ func (c *Controller) Start(targetPath string, launchCmd []string) error {
 	if len(launchCmd) == 0 {
 		launchCmd = append([]string(nil), c.defaultCmd...)
 	}
-	cmd := exec.Command(launchCmd[0], launchCmd[1:]...)
-	cmd.Dir = absPath
+	return c.launch(absPath, launchCmd, policy, 0)
+}
+
+// launch execs the instance-shim into a new session for launchCmd and
+// registers its pid with the reaper. The shim itself (not launchCmd)
+// becomes the controller's direct child: it forks the real command, reports
+// its pid back through a handshake file, and owns the log files, so a slow
+// or wedged child can never tie up the controller's process table entry.
+// retryCount carries over the number of consecutive failed attempts so far,
+// so backoff and StartRetries accounting survive across relaunches.
+func (c *Controller) launch(absPath string, launchCmd []string, policy InstancePolicy, retryCount int) error {
 	if err := os.MkdirAll(filepath.Join(absPath, "logs"), 0755); err != nil {
 		return err
 	}
-	stdoutF, _ := os.OpenFile(filepath.Join(absPath, "logs", "stdout.log"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
-	stderrF, _ := os.OpenFile(filepath.Join(absPath, "logs", "stderr.log"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
-	if stdoutF != nil {
-		cmd.Stdout = stdoutF
+	shimBin, err := c.resolveShimPath()
+	if err != nil {
+		return err
+	}
+	handshakePath, socketPath, logSocketPath := shimPaths(absPath)
+	_ = os.Remove(handshakePath)
+	_ = os.Remove(socketPath)
+
+	prevRec, _ := c.loadRecord(absPath)
+
+	shimArgs := []string{
+		"-dir=" + absPath,
+		"-stdout=" + logFilePath(absPath, "stdout"),
+		"-stderr=" + logFilePath(absPath, "stderr"),
+		"-handshake=" + handshakePath,
+		"-socket=" + socketPath,
+	}
+	var logSocket string
+	if c.logMaxSize > 0 {
+		logSocket = logSocketPath
+		shimArgs = append(shimArgs,
+			fmt.Sprintf("-log-max-size=%d", c.logMaxSize),
+			fmt.Sprintf("-log-max-files=%d", c.logMaxFiles),
+			fmt.Sprintf("-log-compress=%t", c.logCompress),
+			fmt.Sprintf("-log-stdout-index=%d", prevRec.StdoutRotation),
+			fmt.Sprintf("-log-stderr-index=%d", prevRec.StderrRotation),
+			"-logsocket="+logSocketPath,
+		)
+	}
+	shimArgs = append(shimArgs, "--")
+	shimArgs = append(shimArgs, launchCmd...)
+
+	cmd := exec.Command(shimBin, shimArgs...)
+	cmd.Dir = absPath
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+
+	if err := c.saveRecord(absPath, InstanceRecord{
+		State:          StateStarting,
+		LaunchCmd:      launchCmd,
+		Policy:         policy,
+		RetryCount:     retryCount,
+		LogSocket:      logSocket,
+		StdoutRotation: prevRec.StdoutRotation,
+		StderrRotation: prevRec.StderrRotation,
+	}); err != nil {
+		return err
 	}
-	if stderrF != nil {
-		cmd.Stderr = stderrF
+	shimPID, err := startAndRegister(cmd, c, &instanceHandle{
+		absPath:    absPath,
+		launchCmd:  launchCmd,
+		policy:     policy,
+		retryCount: retryCount,
+		startedAt:  time.Now(),
+	})
+	if err != nil {
+		_ = c.saveRecord(absPath, InstanceRecord{State: StateFailed, LastError: err.Error(), LaunchCmd: launchCmd, Policy: policy, RetryCount: retryCount})
+		return err
 	}
-	if err := c.saveRecord(absPath, InstanceRecord{State: StateStarting}); err != nil {
-		if stdoutF != nil {
-			_ = stdoutF.Close()
-		}
-		if stderrF != nil {
-			_ = stderrF.Close()
-		}
+
+	hs, err := instanceshim.ReadHandshake(handshakePath, c.handshakeWait)
+	if err != nil {
+		unregisterHandle(shimPID)
+		_ = cmd.Process.Kill()
+		_ = c.saveRecord(absPath, InstanceRecord{State: StateFailed, LastError: err.Error(), LaunchCmd: launchCmd, Policy: policy, RetryCount: retryCount})
 		return err
 	}
+
+	_ = c.saveRecord(absPath, InstanceRecord{
+		State:          StateRunning,
+		PID:            hs.PID,
+		ShimPID:        cmd.Process.Pid,
+		ShimSocket:     socketPath,
+		StartedAt:      time.Now().UTC(),
+		LaunchCmd:      launchCmd,
+		Policy:         policy,
+		RetryCount:     retryCount,
+		LogSocket:      logSocket,
+		StdoutRotation: prevRec.StdoutRotation,
+		StderrRotation: prevRec.StderrRotation,
+	})
+	return nil
+}
+
+// backoffDelay returns the delay before the next restart attempt:
+// BackoffInitial for the first consecutive failure (or after a run that
+// lasted StartSeconds, retryCount 0), doubling with each further consecutive
+// failure up to BackoffMax.
+func backoffDelay(policy InstancePolicy, retryCount int) time.Duration {
+	initial := policy.BackoffInitial
+	if initial <= 0 {
+		initial = time.Second
+	}
+	delay := initial
+	for i := 1; i < retryCount; i++ {
+		delay *= 2
+		if policy.BackoffMax > 0 && delay >= policy.BackoffMax {
+			delay = policy.BackoffMax
+			break
+		}
+	}
+	return delay
+}
+
+// instanceHandle is what the reaper needs to finish up after a shim exits:
+// enough to decide on autorestart and to persist the outcome, without
+// holding a per-instance lock while it does so.
+type instanceHandle struct {
+	absPath    string
+	launchCmd  []string
+	policy     InstancePolicy
+	retryCount int
+	startedAt  time.Time
+}
+
+var (
+	reaperOnce    sync.Once
+	reaperMu      sync.Mutex
+	reaperHandles = map[int]reaperEntry{}
+)
+
+type reaperEntry struct {
+	controller *Controller
+	handle     *instanceHandle
+}
+
+// startAndRegister starts cmd and records that its pid belongs to c and
+// should be dispatched to c.onExit once the reaper reaps it, holding
+// reaperMu across both so the two happen atomically with respect to the
+// reaper. Without that, a shim that exits immediately after forking could be
+// reaped and its SIGCHLD dispatched before the map entry existed, silently
+// dropping the exit event; with the lock held, the reaper's own lookup of
+// reaperHandles simply blocks until registration completes instead. It also
+// lazily starts the single process-wide reaper goroutine, since SIGCHLD
+// delivery is per process, not per Controller.
+func startAndRegister(cmd *exec.Cmd, c *Controller, h *instanceHandle) (int, error) {
+	startReaper()
+	reaperMu.Lock()
+	defer reaperMu.Unlock()
 	if err := cmd.Start(); err != nil {
-		_ = c.saveRecord(absPath, InstanceRecord{State: StateFailed, LastError: err.Error()})
-		if stdoutF != nil {
-			_ = stdoutF.Close()
+		return 0, err
+	}
+	pid := cmd.Process.Pid
+	reaperHandles[pid] = reaperEntry{controller: c, handle: h}
+	return pid, nil
+}
+
+func unregisterHandle(pid int) {
+	reaperMu.Lock()
+	delete(reaperHandles, pid)
+	reaperMu.Unlock()
+}
+
+// startReaper installs a SIGCHLD handler and drains exited children with
+// wait4(2) instead of spawning one blocking cmd.Wait goroutine per instance,
+// so a slow exit on one instance can never delay state updates for another.
+func startReaper() {
+	reaperOnce.Do(func() {
+		ch := make(chan os.Signal, 1)
+		signal.Notify(ch, syscall.SIGCHLD)
+		go func() {
+			for range ch {
+				reapTrackedChildren()
+			}
+		}()
+	})
+}
+
+// reapTrackedChildren harvests exit status only for pids currently in
+// reaperHandles, via a targeted wait4(pid, ...) per pid. It deliberately
+// never calls wait4(-1, ...): that reaps *any* child of this process, so in
+// a host binary that also runs other subprocesses (including, as it turns
+// out, this package's own tests shelling out to `go build`), it can steal
+// an unrelated exec.Cmd's exit status out from under its own Wait() and
+// leave it with a spurious ECHILD.
+func reapTrackedChildren() {
+	for {
+		reaperMu.Lock()
+		pids := make([]int, 0, len(reaperHandles))
+		for pid := range reaperHandles {
+			pids = append(pids, pid)
+		}
+		reaperMu.Unlock()
+
+		reapedAny := false
+		for _, pid := range pids {
+			var ws syscall.WaitStatus
+			got, err := syscall.Wait4(pid, &ws, syscall.WNOHANG, nil)
+			if err != nil || got <= 0 {
+				continue
+			}
+			reaperMu.Lock()
+			entry, ok := reaperHandles[got]
+			if ok {
+				delete(reaperHandles, got)
+			}
+			reaperMu.Unlock()
+			if ok {
+				reapedAny = true
+				go entry.controller.onExit(entry.handle, ws)
+			}
 		}
-		if stderrF != nil {
-			_ = stderrF.Close()
+		if !reapedAny {
+			return
 		}
-		return err
 	}
-	pid := cmd.Process.Pid
-	_ = c.saveRecord(absPath, InstanceRecord{State: StateRunning, PID: pid, StartedAt: time.Now().UTC()})
-	go c.watchProcess(absPath, cmd, stdoutF, stderrF)
-	return nil
 }
 
-func (c *Controller) watchProcess(absPath string, cmd *exec.Cmd, stdoutF, stderrF *os.File) {
-	c.watchLock.Lock()
-	defer c.watchLock.Unlock()
-	err := cmd.Wait()
-	rec := InstanceRecord{UpdatedAt: time.Now().UTC()}
-	if err != nil {
-		rec.State = StateFailed
-		rec.LastError = err.Error()
-	} else {
+// describeExit turns a raw wait status into an InstanceRecord-friendly
+// message, mirroring the text *exec.ExitError would have produced.
+func describeExit(ws syscall.WaitStatus) (clean bool, msg string) {
+	if ws.Signaled() {
+		return false, fmt.Sprintf("signal: %s", ws.Signal())
+	}
+	if ws.ExitStatus() != 0 {
+		return false, fmt.Sprintf("exit status %d", ws.ExitStatus())
+	}
+	return true, ""
+}
+
+// onExit is invoked by the reaper once a shim's exit has been harvested. It
+// carries out the same autorestart decision watchProcess used to make
+// inline, but off of the reaper goroutine and without any per-instance lock.
+func (c *Controller) onExit(h *instanceHandle, ws syscall.WaitStatus) {
+	if c.consumeStopping(h.absPath) {
+		_ = c.saveRecord(h.absPath, InstanceRecord{
+			State:     StateStopped,
+			StoppedAt: time.Now().UTC(),
+			LaunchCmd: h.launchCmd,
+			Policy:    h.policy,
+		})
+		return
+	}
+
+	// The handle carries the count this launch started with; a lower
+	// persisted count means ResetBackoff cleared it since.
+	retryCount := h.retryCount
+	if rec, err := c.loadRecord(h.absPath); err == nil && rec.RetryCount < retryCount {
+		retryCount = rec.RetryCount
+	}
+	clean, msg := describeExit(ws)
+	c.finishExit(h.absPath, h.launchCmd, h.policy, retryCount, h.startedAt, clean, msg)
+}
+
+// finishExit carries out the autorestart decision once an instance's exit
+// (however it was observed) is known: if policy.AutoRestart is set, relaunch
+// it while its count of consecutive too-fast failures (reset to 0 by a run
+// that lasted StartSeconds) is still below policy.StartRetries, and
+// otherwise record it as failed; without AutoRestart, record it as stopped
+// or failed by its exit status. onExit (reaped
+// directly by this process) and reconcileOne (relayed via AwaitExit after a
+// controller restart) are the only two ways an exit is observed, and both
+// share this so a reconciled instance's AutoRestart policy is honored the
+// same way a locally-launched one's is.
+func (c *Controller) finishExit(absPath string, launchCmd []string, policy InstancePolicy, retryCount int, startedAt time.Time, clean bool, msg string) {
+	ranLongEnough := policy.StartSeconds <= 0 || time.Since(startedAt) >= time.Duration(policy.StartSeconds)*time.Second
+
+	if policy.AutoRestart {
+		nextRetryCount := retryCount
+		if ranLongEnough {
+			nextRetryCount = 0
+		} else {
+			nextRetryCount++
+		}
+		if nextRetryCount < policy.StartRetries {
+			delay := backoffDelay(policy, nextRetryCount)
+			rec := InstanceRecord{
+				State:       StateRetryWait,
+				LaunchCmd:   launchCmd,
+				Policy:      policy,
+				RetryCount:  nextRetryCount,
+				NextRetryAt: time.Now().Add(delay),
+				LastError:   msg,
+			}
+			_ = c.saveRecord(absPath, rec)
+			time.Sleep(delay)
+			if launchErr := c.launch(absPath, launchCmd, policy, nextRetryCount); launchErr == nil {
+				return
+			}
+		}
+		_ = c.saveRecord(absPath, InstanceRecord{
+			State:      StateFailed,
+			LastError:  "exceeded start retries",
+			LaunchCmd:  launchCmd,
+			Policy:     policy,
+			RetryCount: nextRetryCount,
+		})
+		return
+	}
+
+	rec := InstanceRecord{LaunchCmd: launchCmd, Policy: policy}
+	if clean {
 		rec.State = StateStopped
 		rec.StoppedAt = time.Now().UTC()
+	} else {
+		rec.State = StateFailed
+		rec.LastError = msg
 	}
-	rec.PID = 0
 	_ = c.saveRecord(absPath, rec)
-	if stdoutF != nil {
-		_ = stdoutF.Close()
-	}
-	if stderrF != nil {
-		_ = stderrF.Close()
-	}
 }
 
+// Stop only ever signals rec.PID and polls isPidAlive; it never waits on the
+// shim's *exec.Cmd itself, so it can't race the reaper for the same wait4.
+// Before signaling, it marks absPath as stopping (markStopping/
+// consumeStopping) so whichever goroutine observes the resulting exit next —
+// onExit for a locally-launched instance, reconcileOne for one picked up by
+// Reconcile after a controller restart — treats it as the deliberate stop it
+// is rather than a crash to autorestart.
 func (c *Controller) Stop(targetPath string) error {
 	absPath, err := filepath.Abs(targetPath)
 	if err != nil {
@@ -241,6 +671,7 @@ func (c *Controller) Stop(targetPath string) error {
 		_ = c.saveRecord(absPath, InstanceRecord{State: StateStopped, StoppedAt: time.Now().UTC()})
 		return nil
 	}
+	c.markStopping(absPath)
 	pid := rec.PID
 	proc, err := os.FindProcess(pid)
 	if err != nil {
@@ -271,11 +702,193 @@ func (c *Controller) GetState(targetPath string) (InstanceRecord, error) {
 	if err != nil {
 		return rec, err
 	}
+	changed := false
 	if rec.PID != 0 && !isPidAlive(rec.PID) {
 		rec.State = StateStopped
 		rec.PID = 0
+		changed = true
+	}
+	// The rotation index is authoritative on the shim's sidecar file, not in
+	// our own last-saved record, since the shim rotates segments on its own
+	// schedule between saves; pick up whatever it's gotten to.
+	if idx, err := logrotate.ReadIndex(logFilePath(absPath, "stdout")); err == nil && idx != rec.StdoutRotation {
+		rec.StdoutRotation = idx
+		changed = true
+	}
+	if idx, err := logrotate.ReadIndex(logFilePath(absPath, "stderr")); err == nil && idx != rec.StderrRotation {
+		rec.StderrRotation = idx
+		changed = true
+	}
+	if changed {
 		rec.UpdatedAt = time.Now().UTC()
 		_ = c.saveRecord(absPath, rec)
 	}
 	return rec, nil
 }
+
+// Tail returns up to n of the most recent lines from an instance's stdout or
+// stderr ("stdout"/"stderr"). If log rotation is enabled (WithLogRotation)
+// and the shim is still reachable, it is served from the shim's in-memory
+// ring buffer; otherwise it falls back to reading the tail of the plain log
+// file on disk.
+func (c *Controller) Tail(targetPath, stream string, n int) ([]string, error) {
+	absPath, err := filepath.Abs(targetPath)
+	if err != nil {
+		return nil, err
+	}
+	rec, err := c.loadRecord(absPath)
+	if err != nil {
+		return nil, err
+	}
+	if rec.LogSocket != "" {
+		if lines, err := instanceshim.TailLog(rec.LogSocket, stream, n); err == nil {
+			return lines, nil
+		}
+	}
+	return tailFile(logFilePath(absPath, stream), n)
+}
+
+// Follow returns a ReadCloser streaming an instance's stdout or stderr as it
+// is written. Unlike Tail it has no on-disk fallback: it requires log
+// rotation to be enabled, since only the rotating writer keeps the live
+// subscriber list Follow reads from.
+func (c *Controller) Follow(targetPath, stream string) (io.ReadCloser, error) {
+	absPath, err := filepath.Abs(targetPath)
+	if err != nil {
+		return nil, err
+	}
+	rec, err := c.loadRecord(absPath)
+	if err != nil {
+		return nil, err
+	}
+	if rec.LogSocket == "" {
+		return nil, errors.New("instancecontrol: Follow requires WithLogRotation")
+	}
+	return instanceshim.FollowLog(rec.LogSocket, stream)
+}
+
+// tailFile is Tail's fallback for when the shim's log socket can't serve the
+// request (log rotation isn't enabled, or the shim is gone): it reads the
+// whole file, which for an uncapped plain log is exactly what
+// WithLogRotation's ring buffer exists to avoid.
+func tailFile(path string, n int) ([]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	trimmed := strings.TrimRight(string(b), "\n")
+	if trimmed == "" {
+		return nil, nil
+	}
+	lines := strings.Split(trimmed, "\n")
+	if n > 0 && n < len(lines) {
+		lines = lines[len(lines)-n:]
+	}
+	return lines, nil
+}
+
+// ResetBackoff clears the retry counter for path so the next autorestart
+// attempt uses the initial backoff instead of continuing to double from
+// wherever a previous run of failures left off. It does not affect a restart
+// that is currently sleeping in onExit.
+func (c *Controller) ResetBackoff(path string) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	rec, err := c.loadRecord(absPath)
+	if err != nil {
+		return err
+	}
+	rec.RetryCount = 0
+	rec.NextRetryAt = time.Time{}
+	return c.saveRecord(absPath, rec)
+}
+
+// ListInstances enumerates every instance the controller has a record for,
+// keyed by the path each record was saved under; Start and the other
+// Controller methods always save under the absolute path. It requires a DB backend that supports Scan; mineDBAdapter
+// does not, so callers that need ListInstances or Reconcile should use
+// leveldbstore instead.
+func (c *Controller) ListInstances() (map[string]InstanceRecord, error) {
+	const keyPrefix = "instancecontrol:"
+	out := make(map[string]InstanceRecord)
+	var scanErr error
+	err := c.db.Scan(keyPrefix, func(k, v []byte) bool {
+		var r InstanceRecord
+		if jerr := json.Unmarshal(v, &r); jerr != nil {
+			scanErr = jerr
+			return false
+		}
+		out[strings.TrimPrefix(string(k), keyPrefix)] = r
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if scanErr != nil {
+		return nil, scanErr
+	}
+	return out, nil
+}
+
+// Reconcile enumerates every instance via ListInstances and, for each one
+// left in StateStarting, StateRunning or StateRetryWait that has a shim
+// socket recorded, reconnects to it and resumes waiting for its exit status.
+// This is needed after a controller restart: the shims of instances that
+// were already running are no longer our direct children, so cmd.Wait can't
+// harvest their exit codes and the stale records would otherwise never
+// advance to StateStopped/StateFailed. Records without a shim socket are
+// skipped; that includes every StateRetryWait record and a StateStarting one
+// saved before its shim came up, so a relaunch that was pending when the
+// controller went down is not carried out. Like ListInstances, it requires
+// a DB backend that supports Scan.
+func (c *Controller) Reconcile() error {
+	instances, err := c.ListInstances()
+	if err != nil {
+		return err
+	}
+	for path, rec := range instances {
+		if rec.ShimSocket == "" {
+			continue
+		}
+		switch rec.State {
+		case StateStarting, StateRunning, StateRetryWait:
+			go c.reconcileOne(path, rec)
+		}
+	}
+	return nil
+}
+
+// reconcileOne waits for the relayed exit of an instance Reconcile picked up
+// after a controller restart, then runs it through the same autorestart
+// decision onExit applies to a locally-reaped exit (finishExit), so an
+// AutoRestart policy keeps being honored across restarts instead of quietly
+// lapsing the moment the shim's socket is no longer our direct child's.
+func (c *Controller) reconcileOne(absPath string, rec InstanceRecord) {
+	status, err := instanceshim.AwaitExit(rec.ShimSocket)
+	if c.consumeStopping(absPath) {
+		_ = c.saveRecord(absPath, InstanceRecord{
+			State:     StateStopped,
+			StoppedAt: time.Now().UTC(),
+			LaunchCmd: rec.LaunchCmd,
+			Policy:    rec.Policy,
+		})
+		return
+	}
+
+	var clean bool
+	var msg string
+	switch {
+	case err != nil:
+		msg = err.Error()
+	case status.ExitCode == 0:
+		clean = true
+	default:
+		msg = status.Err
+		if msg == "" {
+			msg = "exit code " + strconv.Itoa(status.ExitCode)
+		}
+	}
+	c.finishExit(absPath, rec.LaunchCmd, rec.Policy, rec.RetryCount, rec.StartedAt, clean, msg)
+}
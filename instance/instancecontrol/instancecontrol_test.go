@@ -1,28 +1,50 @@
 package instancecontrol
 
 import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os/exec"
+	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
 	"time"
+
+	"instance/instanceshim"
 )
 
+// buildShim compiles the instance-shim binary used by Start/Stop tests into
+// t.TempDir() and returns its path. Start execs this binary as a direct
+// child, so the tests need a real one on disk rather than a stub.
+func buildShim(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "instance-shim")
+	cmd := exec.Command("go", "build", "-o", bin, "instance/cmd/instance-shim")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Skipf("could not build instance-shim (skipping shim-backed test): %v\n%s", err, out)
+	}
+	return bin
+}
+
 type fakeDB struct {
 	mu sync.Mutex
-	m  map[string]interface{}
+	m  map[string][]byte
 }
 
 func newFakeDB() *fakeDB {
-	return &fakeDB{m: make(map[string]interface{})}
+	return &fakeDB{m: make(map[string][]byte)}
 }
 
-func (f *fakeDB) Set(key string, value interface{}) error {
+func (f *fakeDB) Set(key string, value []byte) error {
 	f.mu.Lock()
 	defer f.mu.Unlock()
 	f.m[key] = value
 	return nil
 }
 
-func (f *fakeDB) Get(key string) (interface{}, error) {
+func (f *fakeDB) Get(key string) ([]byte, error) {
 	f.mu.Lock()
 	defer f.mu.Unlock()
 	v, ok := f.m[key]
@@ -32,6 +54,27 @@ func (f *fakeDB) Get(key string) (interface{}, error) {
 	return v, nil
 }
 
+func (f *fakeDB) Delete(key string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.m, key)
+	return nil
+}
+
+func (f *fakeDB) Scan(prefix string, fn func(key, value []byte) bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for k, v := range f.m {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+		if !fn([]byte(k), v) {
+			break
+		}
+	}
+	return nil
+}
+
 var ErrKeyNotFound = &keyNotFoundErr{}
 
 type keyNotFoundErr struct{}
@@ -58,9 +101,65 @@ func TestSaveLoadRecord(t *testing.T) {
 	}
 }
 
+func TestListInstances(t *testing.T) {
+	db := newFakeDB()
+	c := NewController(WithDB(db), WithUseAbsPaths(false))
+	if err := c.saveRecord("inst1", InstanceRecord{State: StateRunning, PID: 1}); err != nil {
+		t.Fatalf("saveRecord inst1 error: %v", err)
+	}
+	if err := c.saveRecord("inst2", InstanceRecord{State: StateStopped}); err != nil {
+		t.Fatalf("saveRecord inst2 error: %v", err)
+	}
+	instances, err := c.ListInstances()
+	if err != nil {
+		t.Fatalf("ListInstances error: %v", err)
+	}
+	if len(instances) != 2 {
+		t.Fatalf("expected 2 instances got %d", len(instances))
+	}
+	if instances["inst1"].State != StateRunning {
+		t.Fatalf("expected inst1 running got %s", instances["inst1"].State)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	db := newFakeDB()
+	c := NewController(WithDB(db))
+	dir := t.TempDir()
+
+	events, cancel := c.Subscribe(dir)
+	defer cancel()
+
+	if err := c.saveRecord(dir, InstanceRecord{State: StateStarting}); err != nil {
+		t.Fatalf("saveRecord error: %v", err)
+	}
+	if err := c.saveRecord(dir, InstanceRecord{State: StateRunning, PID: 42}); err != nil {
+		t.Fatalf("saveRecord error: %v", err)
+	}
+
+	select {
+	case ev := <-events:
+		if ev.NewState != StateStarting {
+			t.Fatalf("expected first event NewState %s got %s", StateStarting, ev.NewState)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for first event")
+	}
+
+	select {
+	case ev := <-events:
+		if ev.OldState != StateStarting || ev.NewState != StateRunning {
+			t.Fatalf("expected transition %s->%s got %s->%s", StateStarting, StateRunning, ev.OldState, ev.NewState)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for second event")
+	}
+}
+
 func TestStartStop(t *testing.T) {
 	db := newFakeDB()
-	c := NewController(WithDB(db), WithUseAbsPaths(false), WithGracePeriod(2*time.Second))
+	shimBin := buildShim(t)
+	c := NewController(WithDB(db), WithUseAbsPaths(false), WithGracePeriod(2*time.Second), WithShimPath(shimBin))
 	dir := t.TempDir()
 	cmd := []string{"sh", "-c", "sleep 2"}
 	if err := c.Start(dir, cmd); err != nil {
@@ -89,3 +188,254 @@ func TestStartStop(t *testing.T) {
 		t.Fatalf("expected stopped state got %s", state2.State)
 	}
 }
+
+// TestAutoRestartCrashRelaunch exercises onExit's autorestart path: the
+// instance crashes on its first launch (before StartSeconds elapses), and
+// onExit should relaunch it rather than giving up, since StartRetries
+// allows more than one consecutive failure.
+func TestAutoRestartCrashRelaunch(t *testing.T) {
+	db := newFakeDB()
+	shimBin := buildShim(t)
+	c := NewController(WithDB(db), WithUseAbsPaths(false), WithGracePeriod(2*time.Second), WithShimPath(shimBin))
+	dir := t.TempDir()
+	marker := filepath.Join(dir, "ran")
+	cmd := []string{"sh", "-c", fmt.Sprintf("if [ -f %q ]; then sleep 5; else touch %q; exit 1; fi", marker, marker)}
+	policy := InstancePolicy{AutoRestart: true, StartRetries: 5, StartSeconds: 1, BackoffInitial: 50 * time.Millisecond}
+	if err := c.StartWithPolicy(dir, cmd, policy); err != nil {
+		t.Fatalf("StartWithPolicy error: %v", err)
+	}
+	defer c.Stop(dir)
+
+	deadline := time.Now().Add(5 * time.Second)
+	var state InstanceRecord
+	for time.Now().Before(deadline) {
+		var err error
+		state, err = c.GetState(dir)
+		if err != nil {
+			t.Fatalf("GetState error: %v", err)
+		}
+		if state.State == StateRunning && state.RetryCount >= 1 {
+			return
+		}
+		if state.State == StateFailed {
+			t.Fatalf("instance gave up, expected a relaunch: %+v", state)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for relaunch after crash, last state: %+v", state)
+}
+
+// TestAutoRestartStartRetriesCeiling exercises the give-up path: an instance
+// that keeps crashing immediately should stop being relaunched once it hits
+// StartRetries consecutive failures.
+func TestAutoRestartStartRetriesCeiling(t *testing.T) {
+	db := newFakeDB()
+	shimBin := buildShim(t)
+	c := NewController(WithDB(db), WithUseAbsPaths(false), WithGracePeriod(2*time.Second), WithShimPath(shimBin))
+	dir := t.TempDir()
+	cmd := []string{"sh", "-c", "exit 1"}
+	policy := InstancePolicy{AutoRestart: true, StartRetries: 2, StartSeconds: 1, BackoffInitial: 20 * time.Millisecond}
+	if err := c.StartWithPolicy(dir, cmd, policy); err != nil {
+		t.Fatalf("StartWithPolicy error: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	var state InstanceRecord
+	for time.Now().Before(deadline) {
+		var err error
+		state, err = c.GetState(dir)
+		if err != nil {
+			t.Fatalf("GetState error: %v", err)
+		}
+		if state.State == StateFailed {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if state.State != StateFailed {
+		t.Fatalf("timed out waiting for give-up, last state: %+v", state)
+	}
+	if state.RetryCount != 2 {
+		t.Fatalf("expected give-up at RetryCount 2 got %d", state.RetryCount)
+	}
+}
+
+// TestReaperDoesNotStealUnrelatedChildren guards against the reaper
+// harvesting exit statuses for children it doesn't own: once it's running,
+// any other exec.Command in this binary (e.g. buildShim's own `go build`)
+// must still be able to Wait() on itself without a spurious ECHILD.
+func TestReaperDoesNotStealUnrelatedChildren(t *testing.T) {
+	db := newFakeDB()
+	shimBin := buildShim(t)
+	c := NewController(WithDB(db), WithUseAbsPaths(false), WithShimPath(shimBin))
+	dir := t.TempDir()
+	if err := c.Start(dir, []string{"sh", "-c", "sleep 2"}); err != nil {
+		t.Fatalf("Start error: %v", err)
+	}
+	defer c.Stop(dir)
+
+	for i := 0; i < 20; i++ {
+		if out, err := exec.Command("sh", "-c", "true").CombinedOutput(); err != nil {
+			t.Fatalf("unrelated subprocess failed on iteration %d: %v\n%s", i, err, out)
+		}
+	}
+}
+
+// TestReconcileAutoRestart simulates a controller restart: a record left in
+// StateRunning with an AutoRestart policy and a fake shim socket that
+// immediately reports a crash. Reconcile should relaunch it per the policy
+// the same way onExit would, instead of just marking it StateFailed. The
+// record's StartedAt is well past StartSeconds, so the crash follows a
+// healthy run and the relaunch starts with RetryCount back at 0; the
+// relaunch shows up as StateRunning with a real PID, which the stale record
+// lacks.
+func TestReconcileAutoRestart(t *testing.T) {
+	db := newFakeDB()
+	shimBin := buildShim(t)
+	c := NewController(WithDB(db), WithUseAbsPaths(false), WithGracePeriod(2*time.Second), WithShimPath(shimBin))
+	dir := t.TempDir()
+
+	sockPath := filepath.Join(t.TempDir(), "shim.sock")
+	l, err := net.Listen("unix", sockPath)
+	if err != nil {
+		t.Fatalf("Listen error: %v", err)
+	}
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_ = json.NewEncoder(conn).Encode(instanceshim.Status{Exited: true, ExitCode: 1})
+	}()
+
+	policy := InstancePolicy{AutoRestart: true, StartRetries: 3, StartSeconds: 1, BackoffInitial: 20 * time.Millisecond}
+	rec := InstanceRecord{
+		State:      StateRunning,
+		ShimSocket: sockPath,
+		LaunchCmd:  []string{"sh", "-c", "sleep 2"},
+		Policy:     policy,
+		StartedAt:  time.Now().Add(-5 * time.Second),
+	}
+	if err := c.saveRecord(dir, rec); err != nil {
+		t.Fatalf("saveRecord error: %v", err)
+	}
+
+	if err := c.Reconcile(); err != nil {
+		t.Fatalf("Reconcile error: %v", err)
+	}
+
+	deadline := time.Now().Add(3 * time.Second)
+	var state InstanceRecord
+	for time.Now().Before(deadline) {
+		state, err = c.GetState(dir)
+		if err != nil {
+			t.Fatalf("GetState error: %v", err)
+		}
+		if state.State == StateRunning && state.PID != 0 {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if state.State != StateRunning || state.PID == 0 || state.RetryCount != 0 {
+		t.Fatalf("expected Reconcile to relaunch per the AutoRestart policy with RetryCount reset to 0, got %+v", state)
+	}
+	_ = c.Stop(dir)
+}
+
+// TestStopDuringReconcile exercises a deliberate Stop on an instance that
+// Reconcile picked up (simulating a controller restart, by dropping the
+// local reaper handle a real Start would have registered): Stop must still
+// land the instance on StateStopped rather than racing reconcileOne, which
+// has no local handle to consult, onto StateFailed.
+func TestStopDuringReconcile(t *testing.T) {
+	db := newFakeDB()
+	shimBin := buildShim(t)
+	c := NewController(WithDB(db), WithUseAbsPaths(false), WithGracePeriod(2*time.Second), WithShimPath(shimBin))
+	dir := t.TempDir()
+	if err := c.Start(dir, []string{"sh", "-c", "sleep 5"}); err != nil {
+		t.Fatalf("Start error: %v", err)
+	}
+
+	rec, err := c.loadRecord(dir)
+	if err != nil {
+		t.Fatalf("loadRecord error: %v", err)
+	}
+	if rec.ShimPID == 0 {
+		t.Fatalf("expected a shim pid to be recorded, got %+v", rec)
+	}
+	// Drop the local reaper registration a real controller restart would
+	// have lost, so only reconcileOne (not onExit) observes this exit.
+	unregisterHandle(rec.ShimPID)
+
+	if err := c.Reconcile(); err != nil {
+		t.Fatalf("Reconcile error: %v", err)
+	}
+
+	if err := c.Stop(dir); err != nil {
+		t.Fatalf("Stop error: %v", err)
+	}
+
+	var state InstanceRecord
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		state, err = c.GetState(dir)
+		if err != nil {
+			t.Fatalf("GetState error: %v", err)
+		}
+		if state.State == StateStopped {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if state.State != StateStopped {
+		t.Fatalf("expected stopped state got %s", state.State)
+	}
+	// Give reconcileOne's AwaitExit a moment to land too, and confirm it
+	// didn't clobber the stopped state with StateFailed.
+	time.Sleep(300 * time.Millisecond)
+	state, err = c.GetState(dir)
+	if err != nil {
+		t.Fatalf("GetState error: %v", err)
+	}
+	if state.State != StateStopped {
+		t.Fatalf("expected state to remain stopped got %s", state.State)
+	}
+}
+
+func TestTailAndFollow(t *testing.T) {
+	db := newFakeDB()
+	shimBin := buildShim(t)
+	c := NewController(WithDB(db), WithUseAbsPaths(false), WithGracePeriod(2*time.Second),
+		WithShimPath(shimBin), WithLogRotation(1<<20, 3, false))
+	dir := t.TempDir()
+	cmd := []string{"sh", "-c", "echo one; echo two; sleep 2"}
+	if err := c.Start(dir, cmd); err != nil {
+		t.Fatalf("Start error: %v", err)
+	}
+	defer c.Stop(dir)
+
+	var lines []string
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		var err error
+		lines, err = c.Tail(dir, "stdout", 10)
+		if err != nil {
+			t.Fatalf("Tail error: %v", err)
+		}
+		if len(lines) >= 2 {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if len(lines) < 2 || lines[0] != "one" || lines[1] != "two" {
+		t.Fatalf("expected [one two] got %v", lines)
+	}
+
+	rc, err := c.Follow(dir, "stdout")
+	if err != nil {
+		t.Fatalf("Follow error: %v", err)
+	}
+	rc.Close()
+}
@@ -0,0 +1,171 @@
+package instancecontrolgrpc
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+
+	"instance/instancecontrol"
+)
+
+// InstanceControlClient is the RPC-level client stub, mirroring
+// InstanceControlServer.
+type InstanceControlClient interface {
+	CreateContainer(ctx context.Context, in *CreateContainerRequest, opts ...grpc.CallOption) (*CreateContainerResponse, error)
+	StartContainer(ctx context.Context, in *StartContainerRequest, opts ...grpc.CallOption) (*StartContainerResponse, error)
+	StopContainer(ctx context.Context, in *StopContainerRequest, opts ...grpc.CallOption) (*StopContainerResponse, error)
+	GetState(ctx context.Context, in *GetStateRequest, opts ...grpc.CallOption) (*InstanceRecord, error)
+	ListInstances(ctx context.Context, in *ListInstancesRequest, opts ...grpc.CallOption) (*ListInstancesResponse, error)
+	Events(ctx context.Context, in *EventsRequest, opts ...grpc.CallOption) (InstanceControl_EventsClient, error)
+}
+
+type InstanceControl_EventsClient interface {
+	Recv() (*InstanceEvent, error)
+	grpc.ClientStream
+}
+
+type instanceControlEventsClient struct{ grpc.ClientStream }
+
+func (x *instanceControlEventsClient) Recv() (*InstanceEvent, error) {
+	m := new(InstanceEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+type instanceControlClient struct {
+	cc *grpc.ClientConn
+}
+
+// NewInstanceControlClient returns the raw RPC client stub for cc.
+func NewInstanceControlClient(cc *grpc.ClientConn) InstanceControlClient {
+	return &instanceControlClient{cc: cc}
+}
+
+func withJSONCodec(opts []grpc.CallOption) []grpc.CallOption {
+	return append(opts, grpc.CallContentSubtype(jsonCodecName))
+}
+
+func (c *instanceControlClient) CreateContainer(ctx context.Context, in *CreateContainerRequest, opts ...grpc.CallOption) (*CreateContainerResponse, error) {
+	out := new(CreateContainerResponse)
+	if err := c.cc.Invoke(ctx, "/instancecontrolgrpc.InstanceControl/CreateContainer", in, out, withJSONCodec(opts)...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *instanceControlClient) StartContainer(ctx context.Context, in *StartContainerRequest, opts ...grpc.CallOption) (*StartContainerResponse, error) {
+	out := new(StartContainerResponse)
+	if err := c.cc.Invoke(ctx, "/instancecontrolgrpc.InstanceControl/StartContainer", in, out, withJSONCodec(opts)...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *instanceControlClient) StopContainer(ctx context.Context, in *StopContainerRequest, opts ...grpc.CallOption) (*StopContainerResponse, error) {
+	out := new(StopContainerResponse)
+	if err := c.cc.Invoke(ctx, "/instancecontrolgrpc.InstanceControl/StopContainer", in, out, withJSONCodec(opts)...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *instanceControlClient) GetState(ctx context.Context, in *GetStateRequest, opts ...grpc.CallOption) (*InstanceRecord, error) {
+	out := new(InstanceRecord)
+	if err := c.cc.Invoke(ctx, "/instancecontrolgrpc.InstanceControl/GetState", in, out, withJSONCodec(opts)...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *instanceControlClient) ListInstances(ctx context.Context, in *ListInstancesRequest, opts ...grpc.CallOption) (*ListInstancesResponse, error) {
+	out := new(ListInstancesResponse)
+	if err := c.cc.Invoke(ctx, "/instancecontrolgrpc.InstanceControl/ListInstances", in, out, withJSONCodec(opts)...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *instanceControlClient) Events(ctx context.Context, in *EventsRequest, opts ...grpc.CallOption) (InstanceControl_EventsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_InstanceControl_serviceDesc.Streams[0], "/instancecontrolgrpc.InstanceControl/Events", withJSONCodec(opts)...)
+	if err != nil {
+		return nil, err
+	}
+	x := &instanceControlEventsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// Client adapts InstanceControlClient onto the same method names and
+// signatures as *instancecontrol.Controller, so a caller can swap a local
+// controller for a remote one without changing call sites.
+type Client struct {
+	rpc InstanceControlClient
+}
+
+// NewClient builds a Client against cc.
+func NewClient(cc *grpc.ClientConn) *Client {
+	return &Client{rpc: NewInstanceControlClient(cc)}
+}
+
+func (c *Client) Start(path string, launchCmd []string) error {
+	return c.StartWithPolicy(path, launchCmd, instancecontrol.InstancePolicy{})
+}
+
+func (c *Client) StartWithPolicy(path string, launchCmd []string, policy instancecontrol.InstancePolicy) error {
+	_, err := c.rpc.StartContainer(context.Background(), &StartContainerRequest{
+		Path:      path,
+		LaunchCmd: launchCmd,
+		Policy:    policyToDTO(policy),
+	})
+	return err
+}
+
+func (c *Client) Stop(path string) error {
+	_, err := c.rpc.StopContainer(context.Background(), &StopContainerRequest{Path: path})
+	return err
+}
+
+func (c *Client) GetState(path string) (instancecontrol.InstanceRecord, error) {
+	resp, err := c.rpc.GetState(context.Background(), &GetStateRequest{Path: path})
+	if err != nil {
+		return instancecontrol.InstanceRecord{}, err
+	}
+	return recordFromDTO(*resp), nil
+}
+
+func (c *Client) ListInstances() (map[string]instancecontrol.InstanceRecord, error) {
+	resp, err := c.rpc.ListInstances(context.Background(), &ListInstancesRequest{})
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]instancecontrol.InstanceRecord, len(resp.Instances))
+	for _, dto := range resp.Instances {
+		out[dto.Path] = recordFromDTO(dto)
+	}
+	return out, nil
+}
+
+func recordFromDTO(dto InstanceRecord) instancecontrol.InstanceRecord {
+	rec := instancecontrol.InstanceRecord{
+		State:      instancecontrol.State(dto.State),
+		PID:        int(dto.PID),
+		LastError:  dto.LastError,
+		LaunchCmd:  dto.LaunchCmd,
+		Policy:     policyFromDTO(dto.Policy),
+		RetryCount: int(dto.RetryCount),
+	}
+	if dto.StartedAtUnix != 0 {
+		rec.StartedAt = timeFromUnix(dto.StartedAtUnix)
+	}
+	if dto.StoppedAtUnix != 0 {
+		rec.StoppedAt = timeFromUnix(dto.StoppedAtUnix)
+	}
+	return rec
+}
@@ -0,0 +1,28 @@
+package instancecontrolgrpc
+
+import (
+	"encoding/json"
+
+	"google.golang.org/grpc/encoding"
+)
+
+// jsonCodecName is registered as a gRPC content-subtype so this service can
+// exchange the plain Go types in types.go without depending on a protoc
+// toolchain to produce proto.Message implementations for them.
+const jsonCodecName = "json"
+
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string { return jsonCodecName }
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,207 @@
+package instancecontrolgrpc
+
+import (
+	"context"
+	"net"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+
+	"instance/instancecontrol"
+)
+
+// memDB is a minimal in-memory instancecontrol.DB, enough to exercise the
+// service without a real backend.
+type memDB struct {
+	mu sync.Mutex
+	m  map[string][]byte
+}
+
+func newMemDB() *memDB { return &memDB{m: make(map[string][]byte)} }
+
+func (d *memDB) Get(key string) ([]byte, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	v, ok := d.m[key]
+	if !ok {
+		return nil, errKeyNotFound
+	}
+	return v, nil
+}
+
+func (d *memDB) Set(key string, value []byte) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.m[key] = value
+	return nil
+}
+
+func (d *memDB) Delete(key string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.m, key)
+	return nil
+}
+
+func (d *memDB) Scan(prefix string, fn func(key, value []byte) bool) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for k, v := range d.m {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+		if !fn([]byte(k), v) {
+			break
+		}
+	}
+	return nil
+}
+
+type notFoundErr struct{}
+
+func (notFoundErr) Error() string { return "key not found" }
+
+var errKeyNotFound = notFoundErr{}
+
+// buildShim compiles the instance-shim binary into t.TempDir() so the
+// round-trip test can exec a real one, mirroring instancecontrol's own
+// buildShim helper.
+func buildShim(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "instance-shim")
+	cmd := exec.Command("go", "build", "-o", bin, "instance/cmd/instance-shim")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Skipf("could not build instance-shim (skipping shim-backed test): %v\n%s", err, out)
+	}
+	return bin
+}
+
+// dialServer starts srv on an in-memory bufconn listener and returns a
+// *grpc.ClientConn dialed against it, plus a cleanup func.
+func dialServer(t *testing.T, srv *grpc.Server) (*grpc.ClientConn, func()) {
+	t.Helper()
+	lis := bufconn.Listen(1024 * 1024)
+	go func() {
+		_ = srv.Serve(lis)
+	}()
+	dialer := func(ctx context.Context, _ string) (net.Conn, error) {
+		return lis.Dial()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	cc, err := grpc.DialContext(ctx, "bufnet",
+		grpc.WithContextDialer(dialer),
+		grpc.WithInsecure(),
+		grpc.WithBlock())
+	if err != nil {
+		t.Fatalf("grpc.DialContext: %v", err)
+	}
+	return cc, func() {
+		cc.Close()
+		srv.Stop()
+		lis.Close()
+	}
+}
+
+func TestCreateContainerValidation(t *testing.T) {
+	ctrl := instancecontrol.NewController(instancecontrol.WithDB(newMemDB()), instancecontrol.WithUseAbsPaths(false))
+	srv := NewInProcessServer(ctrl)
+	cc, cleanup := dialServer(t, srv)
+	defer cleanup()
+
+	client := NewInstanceControlClient(cc)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if _, err := client.CreateContainer(ctx, &CreateContainerRequest{}); err == nil {
+		t.Fatal("expected an error for an empty launch command")
+	}
+	if _, err := client.CreateContainer(ctx, &CreateContainerRequest{LaunchCmd: []string{"true"}}); err != nil {
+		t.Fatalf("CreateContainer error: %v", err)
+	}
+}
+
+func TestListInstancesRoundTrip(t *testing.T) {
+	ctrl := instancecontrol.NewController(instancecontrol.WithDB(newMemDB()), instancecontrol.WithUseAbsPaths(false))
+	srv := NewInProcessServer(ctrl)
+	cc, cleanup := dialServer(t, srv)
+	defer cleanup()
+
+	client := NewClient(cc)
+	instances, err := client.ListInstances()
+	if err != nil {
+		t.Fatalf("ListInstances error: %v", err)
+	}
+	if len(instances) != 0 {
+		t.Fatalf("expected no instances, got %v", instances)
+	}
+}
+
+// TestStartGetStateStopRoundTrip drives a real instance through the gRPC
+// service and client stubs end to end, confirming the JSON codec and
+// hand-rolled dispatch round-trip a live instance's state correctly.
+func TestStartGetStateStopRoundTrip(t *testing.T) {
+	shimBin := buildShim(t)
+	ctrl := instancecontrol.NewController(
+		instancecontrol.WithDB(newMemDB()),
+		instancecontrol.WithUseAbsPaths(false),
+		instancecontrol.WithShimPath(shimBin),
+		instancecontrol.WithGracePeriod(2*time.Second),
+	)
+	srv := NewInProcessServer(ctrl)
+	cc, cleanup := dialServer(t, srv)
+	defer cleanup()
+
+	client := NewClient(cc)
+	dir := t.TempDir()
+	if err := client.Start(dir, []string{"sh", "-c", "sleep 2"}); err != nil {
+		t.Fatalf("Start error: %v", err)
+	}
+
+	var state instancecontrol.InstanceRecord
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		var err error
+		state, err = client.GetState(dir)
+		if err != nil {
+			t.Fatalf("GetState error: %v", err)
+		}
+		if state.State == instancecontrol.StateRunning {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if state.State != instancecontrol.StateRunning {
+		t.Fatalf("expected running state, got %s", state.State)
+	}
+	if state.PID == 0 {
+		t.Fatal("expected non-zero pid")
+	}
+
+	if err := client.Stop(dir); err != nil {
+		t.Fatalf("Stop error: %v", err)
+	}
+
+	deadline = time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		var err error
+		state, err = client.GetState(dir)
+		if err != nil {
+			t.Fatalf("GetState error: %v", err)
+		}
+		if state.State == instancecontrol.StateStopped {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if state.State != instancecontrol.StateStopped {
+		t.Fatalf("expected stopped state, got %s", state.State)
+	}
+}
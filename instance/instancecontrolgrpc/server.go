@@ -0,0 +1,124 @@
+package instancecontrolgrpc
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"instance/instancecontrol"
+	"instance/leveldbstore"
+)
+
+// Server adapts a *instancecontrol.Controller onto InstanceControlServer,
+// translating its error values into the appropriate codes.* so remote
+// callers get normal gRPC status errors instead of opaque strings.
+type Server struct {
+	ctrl *instancecontrol.Controller
+}
+
+// NewServer wraps ctrl for use with RegisterInstanceControlServer.
+func NewServer(ctrl *instancecontrol.Controller) *Server {
+	return &Server{ctrl: ctrl}
+}
+
+// NewInProcessServer builds a *grpc.Server with the InstanceControl service
+// registered against ctrl, ready to Serve on any net.Listener — including an
+// in-memory one (e.g. bufconn) for tests, hence "in-process".
+func NewInProcessServer(ctrl *instancecontrol.Controller) *grpc.Server {
+	s := grpc.NewServer()
+	RegisterInstanceControlServer(s, NewServer(ctrl))
+	return s
+}
+
+// grpcError maps instancecontrol/leveldbstore error values onto grpc status
+// codes; anything unrecognized becomes codes.Internal.
+func grpcError(err error) error {
+	if err == nil {
+		return nil
+	}
+	switch {
+	case errors.Is(err, leveldbstore.ErrKeyNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case err.Error() == "launch command required":
+		return status.Error(codes.InvalidArgument, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+// CreateContainer validates the launch command up front; instancecontrol
+// doesn't have a separate bundle-creation step, so the instance itself is
+// only actually execed once StartContainer is called.
+func (s *Server) CreateContainer(ctx context.Context, req *CreateContainerRequest) (*CreateContainerResponse, error) {
+	if len(req.LaunchCmd) == 0 {
+		return nil, grpcError(errors.New("launch command required"))
+	}
+	return &CreateContainerResponse{}, nil
+}
+
+func (s *Server) StartContainer(ctx context.Context, req *StartContainerRequest) (*StartContainerResponse, error) {
+	if err := s.ctrl.StartWithPolicy(req.Path, req.LaunchCmd, policyFromDTO(req.Policy)); err != nil {
+		return nil, grpcError(err)
+	}
+	return &StartContainerResponse{}, nil
+}
+
+func (s *Server) StopContainer(ctx context.Context, req *StopContainerRequest) (*StopContainerResponse, error) {
+	if err := s.ctrl.Stop(req.Path); err != nil {
+		return nil, grpcError(err)
+	}
+	return &StopContainerResponse{}, nil
+}
+
+func (s *Server) GetState(ctx context.Context, req *GetStateRequest) (*InstanceRecord, error) {
+	rec, err := s.ctrl.GetState(req.Path)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	dto := recordToDTO(req.Path, rec)
+	return &dto, nil
+}
+
+func (s *Server) ListInstances(ctx context.Context, req *ListInstancesRequest) (*ListInstancesResponse, error) {
+	instances, err := s.ctrl.ListInstances()
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	resp := &ListInstancesResponse{Instances: make([]InstanceRecord, 0, len(instances))}
+	for path, rec := range instances {
+		resp.Instances = append(resp.Instances, recordToDTO(path, rec))
+	}
+	return resp, nil
+}
+
+// Events streams every matching InstanceEvent until the client disconnects
+// or the controller's subscription is cancelled.
+func (s *Server) Events(req *EventsRequest, stream InstanceControl_EventsServer) error {
+	var events <-chan instancecontrol.InstanceEvent
+	var cancel func()
+	if req.Path == "" {
+		events, cancel = s.ctrl.SubscribeAll()
+	} else {
+		events, cancel = s.ctrl.Subscribe(req.Path)
+	}
+	defer cancel()
+
+	ctx := stream.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case ev, ok := <-events:
+			if !ok {
+				return nil
+			}
+			dto := eventToDTO(ev)
+			if err := stream.Send(&dto); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package instancecontrolgrpc
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+)
+
+// InstanceControlServer is the interface service.go's handlers dispatch to;
+// Server (in server.go) is the only implementation.
+type InstanceControlServer interface {
+	CreateContainer(context.Context, *CreateContainerRequest) (*CreateContainerResponse, error)
+	StartContainer(context.Context, *StartContainerRequest) (*StartContainerResponse, error)
+	StopContainer(context.Context, *StopContainerRequest) (*StopContainerResponse, error)
+	GetState(context.Context, *GetStateRequest) (*InstanceRecord, error)
+	ListInstances(context.Context, *ListInstancesRequest) (*ListInstancesResponse, error)
+	Events(*EventsRequest, InstanceControl_EventsServer) error
+}
+
+type InstanceControl_EventsServer interface {
+	Send(*InstanceEvent) error
+	grpc.ServerStream
+}
+
+type instanceControlEventsServer struct{ grpc.ServerStream }
+
+func (x *instanceControlEventsServer) Send(m *InstanceEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _InstanceControl_CreateContainer_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateContainerRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(InstanceControlServer).CreateContainer(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/instancecontrolgrpc.InstanceControl/CreateContainer"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(InstanceControlServer).CreateContainer(ctx, req.(*CreateContainerRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _InstanceControl_StartContainer_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StartContainerRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(InstanceControlServer).StartContainer(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/instancecontrolgrpc.InstanceControl/StartContainer"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(InstanceControlServer).StartContainer(ctx, req.(*StartContainerRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _InstanceControl_StopContainer_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StopContainerRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(InstanceControlServer).StopContainer(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/instancecontrolgrpc.InstanceControl/StopContainer"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(InstanceControlServer).StopContainer(ctx, req.(*StopContainerRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _InstanceControl_GetState_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetStateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(InstanceControlServer).GetState(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/instancecontrolgrpc.InstanceControl/GetState"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(InstanceControlServer).GetState(ctx, req.(*GetStateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _InstanceControl_ListInstances_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListInstancesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(InstanceControlServer).ListInstances(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/instancecontrolgrpc.InstanceControl/ListInstances"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(InstanceControlServer).ListInstances(ctx, req.(*ListInstancesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _InstanceControl_Events_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(EventsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(InstanceControlServer).Events(m, &instanceControlEventsServer{stream})
+}
+
+var _InstanceControl_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "instancecontrolgrpc.InstanceControl",
+	HandlerType: (*InstanceControlServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "CreateContainer", Handler: _InstanceControl_CreateContainer_Handler},
+		{MethodName: "StartContainer", Handler: _InstanceControl_StartContainer_Handler},
+		{MethodName: "StopContainer", Handler: _InstanceControl_StopContainer_Handler},
+		{MethodName: "GetState", Handler: _InstanceControl_GetState_Handler},
+		{MethodName: "ListInstances", Handler: _InstanceControl_ListInstances_Handler},
+	},
+	Streams: []grpc.StreamDesc{
+		{StreamName: "Events", Handler: _InstanceControl_Events_Handler, ServerStreams: true},
+	},
+	Metadata: "instance/instancecontrolgrpc/instancecontrol.proto",
+}
+
+// RegisterInstanceControlServer wires srv's methods into s, the same way
+// protoc-gen-go-grpc's generated registration func would.
+func RegisterInstanceControlServer(s *grpc.Server, srv InstanceControlServer) {
+	s.RegisterService(&_InstanceControl_serviceDesc, srv)
+}
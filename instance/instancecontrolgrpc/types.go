@@ -0,0 +1,126 @@
+package instancecontrolgrpc
+
+import (
+	"time"
+
+	"instance/instancecontrol"
+)
+
+// The Go types below mirror instancecontrol.proto field-for-field. They are
+// exchanged over the wire via the "json" gRPC codec registered in codec.go,
+// rather than checked-in protoc output — the .proto is kept as the
+// authoritative interface contract, generate against it if a toolchain with
+// protoc becomes available.
+
+type InstancePolicy struct {
+	AutoRestart      bool  `json:"auto_restart,omitempty"`
+	StartRetries     int32 `json:"start_retries,omitempty"`
+	StartSeconds     int32 `json:"start_seconds,omitempty"`
+	BackoffInitialMs int64 `json:"backoff_initial_ms,omitempty"`
+	BackoffMaxMs     int64 `json:"backoff_max_ms,omitempty"`
+}
+
+func policyToDTO(p instancecontrol.InstancePolicy) InstancePolicy {
+	return InstancePolicy{
+		AutoRestart:      p.AutoRestart,
+		StartRetries:     int32(p.StartRetries),
+		StartSeconds:     int32(p.StartSeconds),
+		BackoffInitialMs: p.BackoffInitial.Milliseconds(),
+		BackoffMaxMs:     p.BackoffMax.Milliseconds(),
+	}
+}
+
+func policyFromDTO(p InstancePolicy) instancecontrol.InstancePolicy {
+	return instancecontrol.InstancePolicy{
+		AutoRestart:    p.AutoRestart,
+		StartRetries:   int(p.StartRetries),
+		StartSeconds:   int(p.StartSeconds),
+		BackoffInitial: time.Duration(p.BackoffInitialMs) * time.Millisecond,
+		BackoffMax:     time.Duration(p.BackoffMaxMs) * time.Millisecond,
+	}
+}
+
+type InstanceRecord struct {
+	Path          string         `json:"path,omitempty"`
+	State         string         `json:"state"`
+	PID           int32          `json:"pid,omitempty"`
+	StartedAtUnix int64          `json:"started_at_unix,omitempty"`
+	StoppedAtUnix int64          `json:"stopped_at_unix,omitempty"`
+	LastError     string         `json:"last_error,omitempty"`
+	LaunchCmd     []string       `json:"launch_cmd,omitempty"`
+	Policy        InstancePolicy `json:"policy,omitempty"`
+	RetryCount    int32          `json:"retry_count,omitempty"`
+}
+
+func recordToDTO(path string, r instancecontrol.InstanceRecord) InstanceRecord {
+	dto := InstanceRecord{
+		Path:       path,
+		State:      string(r.State),
+		PID:        int32(r.PID),
+		LastError:  r.LastError,
+		LaunchCmd:  r.LaunchCmd,
+		Policy:     policyToDTO(r.Policy),
+		RetryCount: int32(r.RetryCount),
+	}
+	if !r.StartedAt.IsZero() {
+		dto.StartedAtUnix = r.StartedAt.Unix()
+	}
+	if !r.StoppedAt.IsZero() {
+		dto.StoppedAtUnix = r.StoppedAt.Unix()
+	}
+	return dto
+}
+
+type CreateContainerRequest struct {
+	Path      string         `json:"path"`
+	LaunchCmd []string       `json:"launch_cmd,omitempty"`
+	Policy    InstancePolicy `json:"policy,omitempty"`
+}
+type CreateContainerResponse struct{}
+
+type StartContainerRequest struct {
+	Path      string         `json:"path"`
+	LaunchCmd []string       `json:"launch_cmd,omitempty"`
+	Policy    InstancePolicy `json:"policy,omitempty"`
+}
+type StartContainerResponse struct{}
+
+type StopContainerRequest struct {
+	Path string `json:"path"`
+}
+type StopContainerResponse struct{}
+
+type GetStateRequest struct {
+	Path string `json:"path"`
+}
+
+type ListInstancesRequest struct{}
+type ListInstancesResponse struct {
+	Instances []InstanceRecord `json:"instances,omitempty"`
+}
+
+type EventsRequest struct {
+	Path string `json:"path,omitempty"`
+}
+
+type InstanceEvent struct {
+	Path     string         `json:"path"`
+	OldState string         `json:"old_state"`
+	NewState string         `json:"new_state"`
+	Record   InstanceRecord `json:"record"`
+	TimeUnix int64          `json:"time_unix"`
+}
+
+func timeFromUnix(sec int64) time.Time {
+	return time.Unix(sec, 0)
+}
+
+func eventToDTO(ev instancecontrol.InstanceEvent) InstanceEvent {
+	return InstanceEvent{
+		Path:     ev.Path,
+		OldState: string(ev.OldState),
+		NewState: string(ev.NewState),
+		Record:   recordToDTO(ev.Path, ev.Record),
+		TimeUnix: ev.Time.Unix(),
+	}
+}
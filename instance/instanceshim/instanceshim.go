@@ -0,0 +1,118 @@
+// Package instanceshim defines the handshake and control-socket protocol
+// spoken between instancecontrol and the instance-shim binary it execs for
+// each managed process. It holds only the shared wire types and the client
+// side of the protocol; the shim's own main loop lives in
+// instance/cmd/instance-shim.
+package instanceshim
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"time"
+)
+
+// Handshake is the JSON payload the shim writes to its handshake file once
+// it has forked the managed process, so the controller can learn the real
+// child's pid without racing the fork.
+type Handshake struct {
+	PID int `json:"pid"`
+}
+
+// Status is the JSON payload the shim publishes on its control socket: once
+// per connection, after the managed process exits (or immediately, if it has
+// already exited by the time the client connects).
+type Status struct {
+	PID      int    `json:"pid"`
+	Exited   bool   `json:"exited"`
+	ExitCode int    `json:"exit_code"`
+	Err      string `json:"error,omitempty"`
+}
+
+// ReadHandshake polls path until the shim has written its handshake file or
+// timeout elapses.
+func ReadHandshake(path string, timeout time.Duration) (Handshake, error) {
+	deadline := time.Now().Add(timeout)
+	var h Handshake
+	for {
+		b, err := os.ReadFile(path)
+		if err == nil {
+			if jerr := json.Unmarshal(b, &h); jerr == nil {
+				return h, nil
+			}
+		}
+		if time.Now().After(deadline) {
+			return h, errors.New("instanceshim: handshake not written before timeout")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// AwaitExit dials the shim's control socket and blocks until it reports that
+// the managed process has exited, or returns immediately if it already has.
+// It is used by Controller.Reconcile after a controller restart, when the
+// shim is no longer our direct child and its exit status can't be harvested
+// with wait(2); the controller's reaper handles its own children directly.
+func AwaitExit(socketPath string) (Status, error) {
+	conn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		return Status{}, err
+	}
+	defer conn.Close()
+	var s Status
+	if err := json.NewDecoder(conn).Decode(&s); err != nil {
+		return Status{}, err
+	}
+	return s, nil
+}
+
+// LogRequest is sent as a single JSON line to the shim's log socket (see
+// -logsocket) to read back or follow a stream's rotated log, which the shim
+// owns via logrotate.Writer.
+type LogRequest struct {
+	Op     string `json:"op"`     // "tail" or "follow"
+	Stream string `json:"stream"` // "stdout" or "stderr"
+	N      int    `json:"n,omitempty"`
+}
+
+// LogResponse answers a "tail" LogRequest.
+type LogResponse struct {
+	Lines []string `json:"lines"`
+}
+
+// TailLog dials the shim's log socket and returns up to n of the most
+// recent lines the rotating writer has seen for stream ("stdout" or
+// "stderr"). It only works against a shim started with log rotation
+// enabled; otherwise no log socket is listening.
+func TailLog(logSocketPath, stream string, n int) ([]string, error) {
+	conn, err := net.Dial("unix", logSocketPath)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if err := json.NewEncoder(conn).Encode(LogRequest{Op: "tail", Stream: stream, N: n}); err != nil {
+		return nil, err
+	}
+	var resp LogResponse
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return nil, err
+	}
+	return resp.Lines, nil
+}
+
+// FollowLog dials the shim's log socket and requests a live feed of stream
+// ("stdout" or "stderr"). The returned ReadCloser yields newline-delimited
+// text written from this point on; the caller closes it to stop following.
+func FollowLog(logSocketPath, stream string) (io.ReadCloser, error) {
+	conn, err := net.Dial("unix", logSocketPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.NewEncoder(conn).Encode(LogRequest{Op: "follow", Stream: stream}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
@@ -0,0 +1,66 @@
+// Package leveldbstore implements instancecontrol.DB on top of
+// github.com/syndtr/goleveldb/leveldb, so instance records can be persisted
+// without depending on the mine_db package.
+package leveldbstore
+
+import (
+	"errors"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	ldberrors "github.com/syndtr/goleveldb/leveldb/errors"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// ErrKeyNotFound is returned by Get when key does not exist.
+var ErrKeyNotFound = errors.New("leveldbstore: key not found")
+
+// Store is a leveldb-backed instancecontrol.DB.
+type Store struct {
+	db *leveldb.DB
+}
+
+// Open opens (or creates) a LevelDB database at path. If the existing
+// database is found corrupted, it is recovered in place via
+// leveldb.RecoverFile and reopened, rather than failing outright.
+func Open(path string) (*Store, error) {
+	db, err := leveldb.OpenFile(path, nil)
+	if ldberrors.IsCorrupted(err) {
+		db, err = leveldb.RecoverFile(path, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+func (s *Store) Get(key string) ([]byte, error) {
+	v, err := s.db.Get([]byte(key), nil)
+	if err == leveldb.ErrNotFound {
+		return nil, ErrKeyNotFound
+	}
+	return v, err
+}
+
+func (s *Store) Set(key string, value []byte) error {
+	return s.db.Put([]byte(key), value, nil)
+}
+
+func (s *Store) Delete(key string) error {
+	return s.db.Delete([]byte(key), nil)
+}
+
+func (s *Store) Scan(prefix string, fn func(key, value []byte) bool) error {
+	iter := s.db.NewIterator(util.BytesPrefix([]byte(prefix)), nil)
+	defer iter.Release()
+	for iter.Next() {
+		if !fn(iter.Key(), iter.Value()) {
+			break
+		}
+	}
+	return iter.Error()
+}
+
+// Close releases the underlying LevelDB handle.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,151 @@
+package leveldbstore
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStoreGetSetDelete(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open error: %v", err)
+	}
+	defer s.Close()
+
+	if _, err := s.Get("missing"); err != ErrKeyNotFound {
+		t.Fatalf("expected ErrKeyNotFound for missing key, got %v", err)
+	}
+
+	if err := s.Set("k1", []byte("v1")); err != nil {
+		t.Fatalf("Set error: %v", err)
+	}
+	v, err := s.Get("k1")
+	if err != nil {
+		t.Fatalf("Get error: %v", err)
+	}
+	if !bytes.Equal(v, []byte("v1")) {
+		t.Fatalf("expected v1 got %q", v)
+	}
+
+	if err := s.Delete("k1"); err != nil {
+		t.Fatalf("Delete error: %v", err)
+	}
+	if _, err := s.Get("k1"); err != ErrKeyNotFound {
+		t.Fatalf("expected ErrKeyNotFound after delete, got %v", err)
+	}
+}
+
+func TestStoreScan(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open error: %v", err)
+	}
+	defer s.Close()
+
+	want := map[string]string{
+		"a:1": "one",
+		"a:2": "two",
+		"b:1": "nope",
+	}
+	for k, v := range want {
+		if err := s.Set(k, []byte(v)); err != nil {
+			t.Fatalf("Set(%q) error: %v", k, err)
+		}
+	}
+
+	got := make(map[string]string)
+	if err := s.Scan("a:", func(k, v []byte) bool {
+		got[string(k)] = string(v)
+		return true
+	}); err != nil {
+		t.Fatalf("Scan error: %v", err)
+	}
+	if len(got) != 2 || got["a:1"] != "one" || got["a:2"] != "two" {
+		t.Fatalf("expected only the a: prefixed keys, got %v", got)
+	}
+
+	var stopped int
+	if err := s.Scan("a:", func(k, v []byte) bool {
+		stopped++
+		return false
+	}); err != nil {
+		t.Fatalf("Scan error: %v", err)
+	}
+	if stopped != 1 {
+		t.Fatalf("expected Scan to stop after the first fn()==false, got %d calls", stopped)
+	}
+}
+
+// TestOpenRecoversCorruptedDB corrupts the MANIFEST of a previously-valid
+// database and checks that Open still succeeds via leveldb.RecoverFile
+// instead of failing outright.
+func TestOpenRecoversCorruptedDB(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open error: %v", err)
+	}
+	if err := s.Set("k1", []byte("v1")); err != nil {
+		t.Fatalf("Set error: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close error: %v", err)
+	}
+
+	manifest, err := currentManifest(dir)
+	if err != nil {
+		t.Fatalf("currentManifest: %v", err)
+	}
+	if err := corruptFile(manifest); err != nil {
+		t.Fatalf("corruptFile: %v", err)
+	}
+
+	s2, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open should have recovered the corrupted db, got error: %v", err)
+	}
+	defer s2.Close()
+
+	if err := s2.Set("k2", []byte("v2")); err != nil {
+		t.Fatalf("Set after recovery error: %v", err)
+	}
+	v, err := s2.Get("k2")
+	if err != nil || !bytes.Equal(v, []byte("v2")) {
+		t.Fatalf("expected to read back v2 after recovery, got %q, err %v", v, err)
+	}
+}
+
+// currentManifest reads the CURRENT file to find the active MANIFEST path.
+func currentManifest(dir string) (string, error) {
+	b, err := os.ReadFile(filepath.Join(dir, "CURRENT"))
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, strings.TrimSpace(string(b))), nil
+}
+
+// corruptFile overwrites the whole of path with 0xff bytes, leaving the file
+// the same size so leveldb still attempts to parse it as a record.
+func corruptFile(path string) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+	if size == 0 {
+		return nil
+	}
+	garbage := bytes.Repeat([]byte{0xff}, int(size))
+	_, err = f.WriteAt(garbage, 0)
+	return err
+}
@@ -0,0 +1,259 @@
+// Package logrotate implements a size-triggered rotating io.Writer, used by
+// instance-shim to cap stdout.log/stderr.log instead of appending to them
+// forever, plus the in-memory ring buffer and live-follower list that back
+// Controller.Tail and Controller.Follow.
+package logrotate
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ringSize bounds how many trailing lines Tail can serve from memory without
+// re-reading the segment off disk. Follow only delivers lines written after
+// it subscribes and never reads the ring.
+const ringSize = 1000
+
+// Writer is an io.Writer over path that rotates to path+".N" once the
+// current segment reaches maxSize, keeping at most maxFiles rolled segments
+// (all of them if maxFiles <= 0; optionally gzip-compressed in the
+// background) and feeding every line it
+// sees into an in-memory ring buffer and any live Follow subscribers.
+type Writer struct {
+	path     string
+	maxSize  int64
+	maxFiles int
+	compress bool
+
+	mu      sync.Mutex
+	f       *os.File
+	size    int64
+	index   int
+	partial []byte
+
+	ring      [ringSize]string
+	ringStart int
+	ringLen   int
+
+	subsMu sync.Mutex
+	subs   []chan string
+}
+
+// New opens (creating if necessary) the writer for path, resuming rotation
+// numbering from startIndex — the value the controller last persisted in
+// InstanceRecord, so a controller restart doesn't clobber the newest rolled
+// segment by starting back over at 0.
+func New(path string, maxSize int64, maxFiles int, compress bool, startIndex int) (*Writer, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	w := &Writer{
+		path:     path,
+		maxSize:  maxSize,
+		maxFiles: maxFiles,
+		compress: compress,
+		f:        f,
+		size:     info.Size(),
+		index:    startIndex,
+	}
+	w.writeIndexSidecar()
+	return w, nil
+}
+
+// Index returns the writer's current rotation index.
+func (w *Writer) Index() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.index
+}
+
+// ReadIndex reads the rotation index last persisted for path by a Writer,
+// without needing one open — used by the controller to refresh
+// InstanceRecord's rotation fields from outside the shim process.
+func ReadIndex(path string) (int, error) {
+	b, err := os.ReadFile(path + ".idx")
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(b)))
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	n, err := w.f.Write(p)
+	w.size += int64(n)
+	w.feedRing(p[:n])
+	if err == nil && w.maxSize > 0 && w.size >= w.maxSize {
+		err = w.rotateLocked()
+	}
+	return n, err
+}
+
+// feedRing splits p on newlines and appends each complete line to the ring
+// buffer and any live Follow subscribers; a line split across two Write
+// calls is reassembled via w.partial.
+func (w *Writer) feedRing(p []byte) {
+	w.partial = append(w.partial, p...)
+	for {
+		i := strings.IndexByte(string(w.partial), '\n')
+		if i < 0 {
+			break
+		}
+		line := string(w.partial[:i])
+		w.partial = append([]byte(nil), w.partial[i+1:]...)
+		w.ring[(w.ringStart+w.ringLen)%ringSize] = line
+		if w.ringLen < ringSize {
+			w.ringLen++
+		} else {
+			w.ringStart = (w.ringStart + 1) % ringSize
+		}
+		w.publish(line)
+	}
+}
+
+func (w *Writer) rotateLocked() error {
+	if err := w.f.Close(); err != nil {
+		return err
+	}
+	w.index++
+	rolled := fmt.Sprintf("%s.%d", w.path, w.index)
+	if err := os.Rename(w.path, rolled); err != nil {
+		return err
+	}
+	if w.compress {
+		go compressFile(rolled)
+	}
+	w.pruneLocked()
+	w.writeIndexSidecar()
+
+	f, err := os.OpenFile(w.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	w.f = f
+	w.size = 0
+	return nil
+}
+
+// pruneLocked removes rolled segments older than maxFiles allows, whether or
+// not a background compressFile has gotten to them yet.
+func (w *Writer) pruneLocked() {
+	if w.maxFiles <= 0 {
+		return
+	}
+	for i := w.index - w.maxFiles; i >= 1; i-- {
+		plain := fmt.Sprintf("%s.%d", w.path, i)
+		if _, err := os.Stat(plain); err == nil {
+			os.Remove(plain)
+			continue
+		}
+		if _, err := os.Stat(plain + ".gz"); err == nil {
+			os.Remove(plain + ".gz")
+			continue
+		}
+		break
+	}
+}
+
+func (w *Writer) writeIndexSidecar() {
+	_ = os.WriteFile(w.path+".idx", []byte(strconv.Itoa(w.index)), 0644)
+}
+
+func compressFile(path string) {
+	in, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer in.Close()
+	out, err := os.Create(path + ".gz")
+	if err != nil {
+		return
+	}
+	defer out.Close()
+	gw := gzip.NewWriter(out)
+	if _, err := io.Copy(gw, in); err != nil {
+		gw.Close()
+		os.Remove(path + ".gz")
+		return
+	}
+	if err := gw.Close(); err != nil {
+		os.Remove(path + ".gz")
+		return
+	}
+	os.Remove(path)
+}
+
+// Tail returns up to n of the most recent complete lines seen by the
+// writer, oldest first.
+func (w *Writer) Tail(n int) []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if n > w.ringLen || n <= 0 {
+		n = w.ringLen
+	}
+	out := make([]string, n)
+	for i := 0; i < n; i++ {
+		out[i] = w.ring[(w.ringStart+w.ringLen-n+i)%ringSize]
+	}
+	return out
+}
+
+// Follow registers a subscriber for lines written from this point on, and a
+// cancel func that unregisters it. Like instancecontrol's event bus, a
+// stalled subscriber only ever loses lines off its own channel; it never
+// blocks Write.
+func (w *Writer) Follow() (<-chan string, func()) {
+	ch := make(chan string, 64)
+	w.subsMu.Lock()
+	w.subs = append(w.subs, ch)
+	w.subsMu.Unlock()
+
+	cancel := func() {
+		w.subsMu.Lock()
+		defer w.subsMu.Unlock()
+		for i, s := range w.subs {
+			if s == ch {
+				w.subs = append(w.subs[:i], w.subs[i+1:]...)
+				close(ch)
+				return
+			}
+		}
+	}
+	return ch, cancel
+}
+
+func (w *Writer) publish(line string) {
+	w.subsMu.Lock()
+	defer w.subsMu.Unlock()
+	for _, ch := range w.subs {
+		select {
+		case ch <- line:
+		default:
+		}
+	}
+}
+
+// Close closes the current segment. It does not touch the subscriber list;
+// any live Follow calls simply stop receiving further lines.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.f.Close()
+}